@@ -31,10 +31,78 @@ import (
 	"math/big"
 )
 
-var (
-	maxBigInt32 = big.NewInt(math.MaxInt32)
-	minBigInt32 = big.NewInt(math.MinInt32)
-)
+// isFloat returns true if the given basic kind is a (untyped or typed)
+// floating point kind.
+func isFloat(kind types.BasicKind) bool {
+	switch kind {
+	case types.UntypedFloatKind, types.Float32Kind, types.Float64Kind:
+		return true
+	}
+	return false
+}
+
+// isComplex returns true if the given basic kind is a (untyped or typed)
+// complex kind.
+func isComplex(kind types.BasicKind) bool {
+	switch kind {
+	case types.UntypedComplexKind, types.Complex64Kind, types.Complex128Kind:
+		return true
+	}
+	return false
+}
+
+// isInt returns true if the given basic kind is an (untyped or typed)
+// integer kind, excluding the special uintptr/unsafe.Pointer kinds.
+func isInt(kind types.BasicKind) bool {
+	switch kind {
+	case types.UntypedIntKind,
+		types.Int8Kind, types.Int16Kind, types.Int32Kind, types.Int64Kind, types.IntKind,
+		types.Uint8Kind, types.Uint16Kind, types.Uint32Kind, types.Uint64Kind, types.UintKind:
+		return true
+	}
+	return false
+}
+
+// isUnsigned returns true if the given basic kind is an unsigned integer
+// kind. Every other integer kind (including UntypedIntKind, which defaults
+// to int) is treated as signed.
+func isUnsigned(kind types.BasicKind) bool {
+	switch kind {
+	case types.Uint8Kind, types.Uint16Kind, types.Uint32Kind, types.Uint64Kind,
+		types.UintKind, types.UintptrKind:
+		return true
+	}
+	return false
+}
+
+// isUntypedNumeric returns true for the untyped numeric kinds that
+// participate in the "wider type wins" rule when folding constants.
+func isUntypedNumeric(kind types.BasicKind) bool {
+	switch kind {
+	case types.UntypedIntKind, types.UntypedFloatKind, types.UntypedComplexKind:
+		return true
+	}
+	return false
+}
+
+// widerUntypedKind returns whichever of a, b is the "wider" untyped numeric
+// kind (int < float < complex), per the usual arithmetic conversions.
+func widerUntypedKind(a, b types.BasicKind) types.BasicKind {
+	rank := func(k types.BasicKind) int {
+		switch k {
+		case types.UntypedComplexKind:
+			return 2
+		case types.UntypedFloatKind:
+			return 1
+		default:
+			return 0
+		}
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
 
 // Value is an interface for representing values returned by Go expressions.
 type Value interface {
@@ -71,6 +139,18 @@ type ConstValue struct {
 	typ      *types.Basic
 }
 
+// NilValue represents the predeclared identifier "nil". Unlike ConstValue,
+// it has no concrete type (and thus no LLVM representation) until it is
+// compared against, or converted to, some other typed Value.
+type NilValue struct {
+	compiler *compiler
+}
+
+// NewNilValue creates a new NilValue.
+func (c *compiler) NewNilValue() NilValue {
+	return NilValue{c}
+}
+
 // Create a new dynamic value from a (LLVM Builder, LLVM Value, Type) triplet.
 func (c *compiler) NewLLVMValue(v llvm.Value, t types.Type) *LLVMValue {
 	return &LLVMValue{c, v, t, false, nil, nil}
@@ -104,7 +184,6 @@ func (lhs *LLVMValue) BinaryOp(op token.Token, rhs_ Value) Value {
 		lhs = lhs.Deref()
 	}
 
-	var result llvm.Value
 	c := lhs.compiler
 	b := lhs.compiler.builder
 
@@ -115,8 +194,20 @@ func (lhs *LLVMValue) BinaryOp(op token.Token, rhs_ Value) Value {
 			rhs = rhs.Deref()
 		}
 
+		// Strings and complex numbers are both laid out as LLVM structs
+		// ({ptr, len} and {real, imag} respectively), but need their own
+		// semantics rather than the generic componentwise struct comparison
+		// below.
+		if basic, ok := types.Underlying(lhs.Type()).(*types.Basic); ok {
+			if basic.Kind == types.StringKind {
+				return lhs.binaryOpString(op, rhs)
+			}
+			if isComplex(basic.Kind) {
+				return lhs.binaryOpComplex(op, rhs)
+			}
+		}
+
 		// Special case for structs.
-		// TODO handle strings as an even more special case.
 		if lhs.value.Type().TypeKind() == llvm.StructTypeKind {
 			// TODO check types are the same.
 			struct_type := lhs.Type()
@@ -163,37 +254,15 @@ func (lhs *LLVMValue) BinaryOp(op token.Token, rhs_ Value) Value {
 			}
 		}
 
-		switch op {
-		case token.MUL:
-			result = b.CreateMul(lhs.value, rhs.value, "")
-		case token.QUO:
-			result = b.CreateUDiv(lhs.value, rhs.value, "")
-		case token.ADD:
-			result = b.CreateAdd(lhs.value, rhs.value, "")
-		case token.SUB:
-			result = b.CreateSub(lhs.value, rhs.value, "")
-		case token.NEQ:
-			result = b.CreateICmp(llvm.IntNE, lhs.value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.EQL:
-			result = b.CreateICmp(llvm.IntEQ, lhs.value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LSS:
-			result = b.CreateICmp(llvm.IntULT, lhs.value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LEQ: // TODO signed/unsigned
-			result = b.CreateICmp(llvm.IntULE, lhs.value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LAND:
-			result = b.CreateAnd(lhs.value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LOR:
-			result = b.CreateOr(lhs.value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		default:
-			panic(fmt.Sprint("Unimplemented operator: ", op))
+		if basic, ok := types.Underlying(lhs.Type()).(*types.Basic); ok {
+			if isFloat(basic.Kind) {
+				return lhs.binaryOpFloat(op, rhs)
+			}
 		}
-		return lhs.compiler.NewLLVMValue(result, lhs.typ)
+
+		return lhs.binaryOpInt(op, rhs.value)
+	case NilValue:
+		return lhs.binaryOpNil(op, rhs)
 	case ConstValue:
 		// Cast untyped rhs to lhs type.
 		switch rhs.typ.Kind {
@@ -204,61 +273,398 @@ func (lhs *LLVMValue) BinaryOp(op token.Token, rhs_ Value) Value {
 		case types.UntypedComplexKind:
 			rhs = rhs.Convert(lhs.Type()).(ConstValue)
 		case types.NilKind:
-			// The conversion will result in an *LLVMValue.
-			// XXX Perhaps this is too lazy. We could optimise some
-			// comparisons, e.g. interface == nil could be optimised
-			// to only compare the type field.
+			// Legacy path for a nil represented as ConstValue{Kind:
+			// NilKind}; new code should produce a NilValue instead, which
+			// binaryOpNil can optimise without materializing a zero value.
 			rhs_llvm := rhs.Convert(lhs.Type()).(*LLVMValue)
 			return lhs.BinaryOp(op, rhs_llvm)
 		}
-		rhs_value := rhs.LLVMValue()
+		if basic, ok := types.Underlying(lhs.Type()).(*types.Basic); ok {
+			if isComplex(basic.Kind) {
+				return lhs.binaryOpComplex(op, lhs.compiler.NewLLVMValue(rhs.LLVMValue(), lhs.typ))
+			}
+			if isFloat(basic.Kind) {
+				return lhs.binaryOpFloat(op, lhs.compiler.NewLLVMValue(rhs.LLVMValue(), lhs.typ))
+			}
+		}
+		return lhs.binaryOpInt(op, rhs.LLVMValue())
+	}
+	panic("unreachable")
+}
+
+// binaryOpNil implements BinaryOp against a literal nil, optimising the
+// comparison to avoid materializing a full zero value of lhs's type: for
+// interfaces we only need to compare the type word, for slices only the
+// ptr field, and for plain pointers/maps/chans/funcs (already a single
+// pointer-sized word) the value itself.
+func (lhs *LLVMValue) binaryOpNil(op token.Token, rhs NilValue) Value {
+	c := lhs.compiler
+	b := c.builder
+	_ = rhs
+
+	var field llvm.Value
+	switch types.Underlying(lhs.Type()).(type) {
+	case *types.Interface, *types.Slice:
+		field = b.CreateExtractValue(lhs.value, 0, "")
+	default:
+		field = lhs.value
+	}
 
+	null := llvm.ConstNull(field.Type())
+	var result llvm.Value
+	switch op {
+	case token.EQL:
+		result = b.CreateICmp(llvm.IntEQ, field, null, "")
+	case token.NEQ:
+		result = b.CreateICmp(llvm.IntNE, field, null, "")
+	default:
+		panic(fmt.Sprint("Unimplemented operator: ", op))
+	}
+	return c.NewLLVMValue(result, types.Bool)
+}
+
+// binaryOpString implements BinaryOp for operands of kind StringKind:
+// concatenation, equality/inequality, and lexicographic ordering. All of
+// these go via small runtime helpers looked up through NamedFunction's
+// runtime symbol table, since they operate over the string's backing byte
+// array rather than its {ptr, len} header.
+func (lhs *LLVMValue) binaryOpString(op token.Token, rhs *LLVMValue) Value {
+	c := lhs.compiler
+	b := c.builder
+	switch op {
+	case token.ADD:
+		fn := c.NamedFunction("runtime.strcat", "func(string, string) string")
+		result := b.CreateCall(fn, []llvm.Value{lhs.value, rhs.value}, "")
+		return c.NewLLVMValue(result, lhs.typ)
+	case token.EQL, token.NEQ:
+		lhs_len := b.CreateExtractValue(lhs.value, 1, "")
+		rhs_len := b.CreateExtractValue(rhs.value, 1, "")
+		len_eq := b.CreateICmp(llvm.IntEQ, lhs_len, rhs_len, "")
+		fn := c.NamedFunction("runtime.streq", "func(string, string) bool")
+		content_eq := b.CreateCall(fn, []llvm.Value{lhs.value, rhs.value}, "")
+		result := b.CreateAnd(len_eq, content_eq, "")
+		if op == token.NEQ {
+			result = b.CreateNot(result, "")
+		}
+		return c.NewLLVMValue(result, types.Bool)
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		fn := c.NamedFunction("runtime.strcmp", "func(string, string) int32")
+		cmp := b.CreateCall(fn, []llvm.Value{lhs.value, rhs.value}, "")
+		zero := llvm.ConstInt(cmp.Type(), 0, false)
+		var pred llvm.IntPredicate
 		switch op {
-		case token.MUL:
-			result = b.CreateMul(lhs.value, rhs_value, "")
-		case token.QUO:
-			result = b.CreateUDiv(lhs.value, rhs_value, "")
-		case token.ADD:
-			result = b.CreateAdd(lhs.value, rhs_value, "")
-		case token.SUB:
-			result = b.CreateSub(lhs.value, rhs_value, "")
-		case token.NEQ:
-			result = b.CreateICmp(llvm.IntNE, lhs.value, rhs_value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.EQL:
-			result = b.CreateICmp(llvm.IntEQ, lhs.value, rhs_value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
 		case token.LSS:
-			result = b.CreateICmp(llvm.IntULT, lhs.value, rhs_value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LEQ: // TODO signed/unsigned
-			result = b.CreateICmp(llvm.IntULE, lhs.value, rhs_value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LAND:
-			result = b.CreateAnd(lhs.value, rhs_value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LOR:
-			result = b.CreateOr(lhs.value, rhs_value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		default:
-			panic(fmt.Sprint("Unimplemented operator: ", op))
+			pred = llvm.IntSLT
+		case token.LEQ:
+			pred = llvm.IntSLE
+		case token.GTR:
+			pred = llvm.IntSGT
+		case token.GEQ:
+			pred = llvm.IntSGE
+		}
+		result := b.CreateICmp(pred, cmp, zero, "")
+		return c.NewLLVMValue(result, types.Bool)
+	default:
+		panic(fmt.Sprint("Unimplemented operator: ", op))
+	}
+}
+
+// stringIndex implements s[i] for a string value: it bounds-checks i
+// against the string's length (panicking via runtime.panicindex if it is
+// out of range) and loads the byte at that offset.
+func (c *compiler) stringIndex(str *LLVMValue, i Value) *LLVMValue {
+	b := c.builder
+	str_ptr := b.CreateExtractValue(str.value, 0, "")
+	str_len := b.CreateExtractValue(str.value, 1, "")
+	i_value := c.normalizeIndexWidth(i, str_len.Type())
+
+	in_bounds := b.CreateICmp(llvm.IntULT, i_value, str_len, "")
+	fn := b.GetInsertBlock().Parent()
+	ok_block := llvm.AddBasicBlock(fn, "")
+	panic_block := llvm.AddBasicBlock(fn, "")
+	b.CreateCondBr(in_bounds, ok_block, panic_block)
+
+	b.SetInsertPointAtEnd(panic_block)
+	panicindex_fn := c.NamedFunction("runtime.panicindex", "func()")
+	b.CreateCall(panicindex_fn, nil, "")
+	b.CreateUnreachable()
+
+	b.SetInsertPointAtEnd(ok_block)
+	elem_ptr := b.CreateGEP(str_ptr, []llvm.Value{i_value}, "")
+	byte_val := b.CreateLoad(elem_ptr, "")
+	return c.NewLLVMValue(byte_val, types.Byte)
+}
+
+// stringSlice implements s[lo:hi] for a string value, producing a new
+// string header that shares the same backing array, offset by lo.
+func (c *compiler) stringSlice(str *LLVMValue, lo, hi Value) *LLVMValue {
+	b := c.builder
+	str_ptr := b.CreateExtractValue(str.value, 0, "")
+	len_typ := str.value.Type().StructElementTypes()[1]
+	lo_value := c.normalizeIndexWidth(lo, len_typ)
+	hi_value := c.normalizeIndexWidth(hi, len_typ)
+
+	new_ptr := b.CreateGEP(str_ptr, []llvm.Value{lo_value}, "")
+	new_len := b.CreateSub(hi_value, lo_value, "")
+
+	result := llvm.Undef(str.value.Type())
+	result = b.CreateInsertValue(result, new_ptr, 0, "")
+	result = b.CreateInsertValue(result, new_len, 1, "")
+	return c.NewLLVMValue(result, str.typ)
+}
+
+// normalizeIndexWidth truncates or (sign/zero-)extends an index/bound
+// operand to llvm_typ, so it can be compared against or combined with the
+// string header's fixed-width length field regardless of the target's
+// native int width.
+func (c *compiler) normalizeIndexWidth(i Value, llvm_typ llvm.Type) llvm.Value {
+	v := i.LLVMValue()
+	src_width := v.Type().IntTypeWidth()
+	dst_width := llvm_typ.IntTypeWidth()
+	switch {
+	case src_width == dst_width:
+		return v
+	case src_width > dst_width:
+		return c.builder.CreateTrunc(v, llvm_typ, "")
+	}
+	if basic, ok := types.Underlying(i.Type()).(*types.Basic); ok && isUnsigned(basic.Kind) {
+		return c.builder.CreateZExt(v, llvm_typ, "")
+	}
+	return c.builder.CreateSExt(v, llvm_typ, "")
+}
+
+// binaryOpInt implements BinaryOp for operands of an integer kind,
+// threading the Go type's signedness through to the appropriate LLVM
+// signed/unsigned opcodes and comparison predicates.
+func (lhs *LLVMValue) binaryOpInt(op token.Token, rhs_value llvm.Value) Value {
+	b := lhs.compiler.builder
+	unsigned := false
+	if basic, ok := types.Underlying(lhs.Type()).(*types.Basic); ok {
+		unsigned = isUnsigned(basic.Kind)
+	}
+
+	var result llvm.Value
+	switch op {
+	case token.MUL:
+		result = b.CreateMul(lhs.value, rhs_value, "")
+	case token.QUO:
+		if unsigned {
+			result = b.CreateUDiv(lhs.value, rhs_value, "")
+		} else {
+			result = b.CreateSDiv(lhs.value, rhs_value, "")
+		}
+	case token.REM:
+		if unsigned {
+			result = b.CreateURem(lhs.value, rhs_value, "")
+		} else {
+			result = b.CreateSRem(lhs.value, rhs_value, "")
+		}
+	case token.ADD:
+		result = b.CreateAdd(lhs.value, rhs_value, "")
+	case token.SUB:
+		result = b.CreateSub(lhs.value, rhs_value, "")
+	case token.SHL:
+		result = b.CreateShl(lhs.value, rhs_value, "")
+	case token.SHR:
+		if unsigned {
+			result = b.CreateLShr(lhs.value, rhs_value, "")
+		} else {
+			result = b.CreateAShr(lhs.value, rhs_value, "")
+		}
+	case token.AND:
+		result = b.CreateAnd(lhs.value, rhs_value, "")
+	case token.OR:
+		result = b.CreateOr(lhs.value, rhs_value, "")
+	case token.XOR:
+		result = b.CreateXor(lhs.value, rhs_value, "")
+	case token.AND_NOT:
+		result = b.CreateAnd(lhs.value, b.CreateNot(rhs_value, ""), "")
+	case token.NEQ:
+		result = b.CreateICmp(llvm.IntNE, lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.EQL:
+		result = b.CreateICmp(llvm.IntEQ, lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.LSS:
+		pred := llvm.IntSLT
+		if unsigned {
+			pred = llvm.IntULT
+		}
+		result = b.CreateICmp(pred, lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.LEQ:
+		pred := llvm.IntSLE
+		if unsigned {
+			pred = llvm.IntULE
+		}
+		result = b.CreateICmp(pred, lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.GTR:
+		pred := llvm.IntSGT
+		if unsigned {
+			pred = llvm.IntUGT
+		}
+		result = b.CreateICmp(pred, lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.GEQ:
+		pred := llvm.IntSGE
+		if unsigned {
+			pred = llvm.IntUGE
 		}
-		return lhs.compiler.NewLLVMValue(result, lhs.typ)
+		result = b.CreateICmp(pred, lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.LAND:
+		// LAND/LOR only ever apply to i1 (bool) operands; bitwise AND/OR
+		// on wider integers go through token.AND/token.OR above, and the
+		// expression visitor is responsible for picking the right token.
+		result = b.CreateAnd(lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.LOR:
+		result = b.CreateOr(lhs.value, rhs_value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	default:
+		panic(fmt.Sprint("Unimplemented operator: ", op))
+	}
+	return lhs.compiler.NewLLVMValue(result, lhs.typ)
+}
+
+// binaryOpFloat implements BinaryOp for operands of a floating point kind.
+func (lhs *LLVMValue) binaryOpFloat(op token.Token, rhs *LLVMValue) Value {
+	b := lhs.compiler.builder
+	var result llvm.Value
+	switch op {
+	case token.MUL:
+		result = b.CreateFMul(lhs.value, rhs.value, "")
+	case token.QUO:
+		result = b.CreateFDiv(lhs.value, rhs.value, "")
+	case token.ADD:
+		result = b.CreateFAdd(lhs.value, rhs.value, "")
+	case token.SUB:
+		result = b.CreateFSub(lhs.value, rhs.value, "")
+	case token.EQL:
+		result = b.CreateFCmp(llvm.FloatOEQ, lhs.value, rhs.value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.NEQ:
+		result = b.CreateFCmp(llvm.FloatONE, lhs.value, rhs.value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.LSS:
+		result = b.CreateFCmp(llvm.FloatOLT, lhs.value, rhs.value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.LEQ:
+		result = b.CreateFCmp(llvm.FloatOLE, lhs.value, rhs.value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.GTR:
+		result = b.CreateFCmp(llvm.FloatOGT, lhs.value, rhs.value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.GEQ:
+		result = b.CreateFCmp(llvm.FloatOGE, lhs.value, rhs.value, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	default:
+		panic(fmt.Sprint("Unimplemented operator: ", op))
+	}
+	return lhs.compiler.NewLLVMValue(result, lhs.typ)
+}
+
+// binaryOpComplex implements BinaryOp for operands of a complex kind,
+// represented in LLVM as a 2-element {real, imag} struct of the
+// corresponding float type.
+func (lhs *LLVMValue) binaryOpComplex(op token.Token, rhs *LLVMValue) Value {
+	b := lhs.compiler.builder
+	a_re := b.CreateExtractValue(lhs.value, 0, "")
+	a_im := b.CreateExtractValue(lhs.value, 1, "")
+	c_re := b.CreateExtractValue(rhs.value, 0, "")
+	c_im := b.CreateExtractValue(rhs.value, 1, "")
+
+	switch op {
+	case token.ADD:
+		re := b.CreateFAdd(a_re, c_re, "")
+		im := b.CreateFAdd(a_im, c_im, "")
+		return lhs.compiler.NewLLVMValue(makeComplex(b, lhs.value.Type(), re, im), lhs.typ)
+	case token.SUB:
+		re := b.CreateFSub(a_re, c_re, "")
+		im := b.CreateFSub(a_im, c_im, "")
+		return lhs.compiler.NewLLVMValue(makeComplex(b, lhs.value.Type(), re, im), lhs.typ)
+	case token.MUL:
+		// (a+bi)(c+di) = (ac-bd) + (ad+bc)i
+		ac := b.CreateFMul(a_re, c_re, "")
+		bd := b.CreateFMul(a_im, c_im, "")
+		ad := b.CreateFMul(a_re, c_im, "")
+		bc := b.CreateFMul(a_im, c_re, "")
+		re := b.CreateFSub(ac, bd, "")
+		im := b.CreateFAdd(ad, bc, "")
+		return lhs.compiler.NewLLVMValue(makeComplex(b, lhs.value.Type(), re, im), lhs.typ)
+	case token.QUO:
+		// (a+bi)/(c+di) = ((ac+bd) + (bc-ad)i) / (c*c+d*d)
+		ac := b.CreateFMul(a_re, c_re, "")
+		bd := b.CreateFMul(a_im, c_im, "")
+		bc := b.CreateFMul(a_im, c_re, "")
+		ad := b.CreateFMul(a_re, c_im, "")
+		cc := b.CreateFMul(c_re, c_re, "")
+		dd := b.CreateFMul(c_im, c_im, "")
+		denom := b.CreateFAdd(cc, dd, "")
+		re := b.CreateFDiv(b.CreateFAdd(ac, bd, ""), denom, "")
+		im := b.CreateFDiv(b.CreateFSub(bc, ad, ""), denom, "")
+		return lhs.compiler.NewLLVMValue(makeComplex(b, lhs.value.Type(), re, im), lhs.typ)
+	case token.EQL:
+		re_eq := b.CreateFCmp(llvm.FloatOEQ, a_re, c_re, "")
+		im_eq := b.CreateFCmp(llvm.FloatOEQ, a_im, c_im, "")
+		result := b.CreateAnd(re_eq, im_eq, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	case token.NEQ:
+		re_ne := b.CreateFCmp(llvm.FloatONE, a_re, c_re, "")
+		im_ne := b.CreateFCmp(llvm.FloatONE, a_im, c_im, "")
+		result := b.CreateOr(re_ne, im_ne, "")
+		return lhs.compiler.NewLLVMValue(result, types.Bool)
+	default:
+		panic(fmt.Sprint("Unimplemented operator: ", op))
 	}
 	panic("unreachable")
 }
 
+// makeComplex builds a {real, imag} struct value of the given LLVM struct
+// type from its two float components.
+func makeComplex(b llvm.Builder, struct_type llvm.Type, re, im llvm.Value) llvm.Value {
+	result := b.CreateInsertValue(llvm.Undef(struct_type), re, 0, "")
+	return b.CreateInsertValue(result, im, 1, "")
+}
+
 func (v *LLVMValue) UnaryOp(op token.Token) Value {
 	b := v.compiler.builder
 	switch op {
 	case token.SUB:
+		v2 := v
 		if v.indirect {
-			v2 := v.Deref()
-			return v.compiler.NewLLVMValue(b.CreateNeg(v2.value, ""), v2.typ)
+			v2 = v.Deref()
 		}
-		return v.compiler.NewLLVMValue(b.CreateNeg(v.value, ""), v.typ)
+		if basic, ok := types.Underlying(v2.Type()).(*types.Basic); ok {
+			if isFloat(basic.Kind) {
+				// A Go "-0.0" constant is +0; build a real negative zero.
+				zero := llvm.ConstFloat(v2.value.Type(), math.Copysign(0, -1))
+				return v.compiler.NewLLVMValue(b.CreateFSub(zero, v2.value, ""), v2.typ)
+			}
+			if isComplex(basic.Kind) {
+				zero := v.compiler.NewLLVMValue(llvm.ConstNull(v2.value.Type()), v2.typ)
+				return zero.binaryOpComplex(token.SUB, v2)
+			}
+		}
+		return v.compiler.NewLLVMValue(b.CreateNeg(v2.value, ""), v2.typ)
 	case token.ADD:
 		return v // No-op
+	case token.NOT:
+		// Logical negation; only ever applies to i1 (bool) operands.
+		v2 := v
+		if v.indirect {
+			v2 = v.Deref()
+		}
+		return v.compiler.NewLLVMValue(b.CreateNot(v2.value, ""), v2.typ)
+	case token.XOR:
+		// Bitwise complement: x ^ -1.
+		v2 := v
+		if v.indirect {
+			v2 = v.Deref()
+		}
+		all_ones := llvm.ConstAllOnes(v2.value.Type())
+		return v.compiler.NewLLVMValue(b.CreateXor(v2.value, all_ones, ""), v2.typ)
 	case token.AND:
 		if v.indirect {
 			return v.compiler.NewLLVMValue(v.value, v.typ)
@@ -307,7 +713,7 @@ func (v *LLVMValue) Convert(dst_typ types.Type) Value {
 		if interface_, isinterface := dst_typ.(*types.Interface); isinterface {
 			return v.convertI2I(interface_)
 		}
-		// TODO I2V
+		return v.convertI2V(orig_dst_typ)
 	}
 
 	// Converting to an interface type.
@@ -315,27 +721,249 @@ func (v *LLVMValue) Convert(dst_typ types.Type) Value {
 		return v.convertV2I(interface_)
 	}
 
-	/*
-	   value_type := value.Type()
-	   switch value_type.TypeKind() {
-	   case llvm.IntegerTypeKind:
-	       switch totype.TypeKind() {
-	       case llvm.IntegerTypeKind:
-	           //delta := value_type.IntTypeWidth() - totype.IntTypeWidth()
-	           //var 
-	           switch {
-	           case delta == 0: return value
-	           // TODO handle signed/unsigned (SExt/ZExt)
-	           case delta < 0: return c.compiler.builder.CreateZExt(value, totype, "")
-	           case delta > 0: return c.compiler.builder.CreateTrunc(value, totype, "")
-	           }
-	           return LLVMValue{lhs.compiler.builder, value}
-	       }
-	   }
-	*/
+	// []byte/[]rune <-> string go via runtime helpers.
+	if result, ok := v.convertStringSlice(src_typ, dst_typ, orig_dst_typ); ok {
+		return result
+	}
+
+	if src_basic, ok := src_typ.(*types.Basic); ok {
+		if dst_basic, ok := dst_typ.(*types.Basic); ok {
+			return v.convertBasic(src_basic, dst_basic, orig_dst_typ)
+		}
+	}
+
+	// Pointer <-> pointer, and pointer <-> uintptr/unsafe.Pointer.
+	if result, ok := v.convertPointer(src_typ, dst_typ, orig_dst_typ); ok {
+		return result
+	}
+
 	panic(fmt.Sprint("unimplemented conversion: ", v.typ, " -> ", orig_dst_typ))
 }
 
+// convertBasic converts between two *types.Basic kinds: integer<->integer,
+// float<->float, integer<->float, and anything involving a complex kind.
+func (v *LLVMValue) convertBasic(src_basic, dst_basic *types.Basic, dst_typ types.Type) Value {
+	switch {
+	case isComplex(src_basic.Kind) || isComplex(dst_basic.Kind):
+		return v.convertComplex(dst_basic, dst_typ)
+	case isFloat(src_basic.Kind) && isFloat(dst_basic.Kind):
+		return v.convertFloatToFloat(src_basic, dst_basic, dst_typ)
+	case isFloat(src_basic.Kind):
+		return v.convertFloatToInt(dst_basic, dst_typ)
+	case isFloat(dst_basic.Kind):
+		return v.convertIntToFloat(src_basic, dst_typ)
+	case (isInt(src_basic.Kind) || src_basic.Kind == types.UintptrKind) &&
+		(isInt(dst_basic.Kind) || dst_basic.Kind == types.UintptrKind):
+		return v.convertIntToInt(src_basic, dst_basic, dst_typ)
+	default:
+		panic(fmt.Sprint("unimplemented conversion: ", src_basic, " -> ", dst_typ))
+	}
+}
+
+// convertIntToInt implements integer-to-integer conversion, truncating or
+// (sign/zero-)extending as required by the relative bit widths.
+func (v *LLVMValue) convertIntToInt(src_basic, dst_basic *types.Basic, dst_typ types.Type) Value {
+	c := v.compiler
+	b := c.builder
+	dst_llvm := c.types.ToLLVM(dst_typ)
+	src_width := v.value.Type().IntTypeWidth()
+	dst_width := dst_llvm.IntTypeWidth()
+
+	var result llvm.Value
+	switch {
+	case src_width == dst_width:
+		result = v.value
+	case src_width > dst_width:
+		result = b.CreateTrunc(v.value, dst_llvm, "")
+	case isUnsigned(src_basic.Kind):
+		result = b.CreateZExt(v.value, dst_llvm, "")
+	default:
+		result = b.CreateSExt(v.value, dst_llvm, "")
+	}
+	return c.NewLLVMValue(result, dst_typ)
+}
+
+// convertFloatToFloat implements float-to-float conversion (float32 <->
+// float64).
+func (v *LLVMValue) convertFloatToFloat(src_basic, dst_basic *types.Basic, dst_typ types.Type) Value {
+	c := v.compiler
+	b := c.builder
+	dst_llvm := c.types.ToLLVM(dst_typ)
+
+	var result llvm.Value
+	switch {
+	case src_basic.Kind == dst_basic.Kind:
+		result = v.value
+	case dst_basic.Kind == types.Float64Kind:
+		result = b.CreateFPExt(v.value, dst_llvm, "")
+	default:
+		result = b.CreateFPTrunc(v.value, dst_llvm, "")
+	}
+	return c.NewLLVMValue(result, dst_typ)
+}
+
+// convertIntToFloat implements integer-to-float conversion.
+func (v *LLVMValue) convertIntToFloat(src_basic *types.Basic, dst_typ types.Type) Value {
+	c := v.compiler
+	b := c.builder
+	dst_llvm := c.types.ToLLVM(dst_typ)
+
+	var result llvm.Value
+	if isUnsigned(src_basic.Kind) {
+		result = b.CreateUIToFP(v.value, dst_llvm, "")
+	} else {
+		result = b.CreateSIToFP(v.value, dst_llvm, "")
+	}
+	return c.NewLLVMValue(result, dst_typ)
+}
+
+// convertFloatToInt implements float-to-integer conversion.
+func (v *LLVMValue) convertFloatToInt(dst_basic *types.Basic, dst_typ types.Type) Value {
+	c := v.compiler
+	b := c.builder
+	dst_llvm := c.types.ToLLVM(dst_typ)
+
+	var result llvm.Value
+	if isUnsigned(dst_basic.Kind) {
+		result = b.CreateFPToUI(v.value, dst_llvm, "")
+	} else {
+		result = b.CreateFPToSI(v.value, dst_llvm, "")
+	}
+	return c.NewLLVMValue(result, dst_typ)
+}
+
+// convertComplex implements conversion to/from a complex kind, extending or
+// truncating the underlying {real, imag} float components as necessary.
+// Converting a floating point number to complex sets the imaginary part to
+// 0; complex64 <-> complex128 re-casts both components. An integer source
+// is not converted to floating point first.
+func (v *LLVMValue) convertComplex(dst_basic *types.Basic, dst_typ types.Type) Value {
+	c := v.compiler
+	b := c.builder
+	dst_llvm := c.types.ToLLVM(dst_typ)
+	float_type := dst_llvm.StructElementTypes()[0]
+
+	cast := func(f llvm.Value) llvm.Value {
+		if f.Type() == float_type {
+			return f
+		}
+		if dst_basic.Kind == types.Complex128Kind {
+			return b.CreateFPExt(f, float_type, "")
+		}
+		return b.CreateFPTrunc(f, float_type, "")
+	}
+
+	var re, im llvm.Value
+	if v.value.Type().TypeKind() == llvm.StructTypeKind {
+		re = cast(b.CreateExtractValue(v.value, 0, ""))
+		im = cast(b.CreateExtractValue(v.value, 1, ""))
+	} else {
+		re = cast(v.value)
+		im = llvm.ConstNull(float_type)
+	}
+	return c.NewLLVMValue(makeComplex(b, dst_llvm, re, im), dst_typ)
+}
+
+// convertI2V performs an interface-to-concrete-type (I2V) conversion,
+// asserting at runtime that the interface currently holds a value of
+// exactly dst_typ, panicking via runtime.ifacetypeassert otherwise, and
+// loading the concrete value out of the interface's data word.
+func (v *LLVMValue) convertI2V(dst_typ types.Type) Value {
+	c := v.compiler
+	b := c.builder
+	intptr_type := c.target.IntPtrType()
+
+	iface_type := b.CreatePtrToInt(b.CreateExtractValue(v.value, 0, ""), intptr_type, "")
+	iface_data := b.CreateExtractValue(v.value, 1, "")
+	want_type := b.CreatePtrToInt(c.types.ToRuntime(dst_typ), intptr_type, "")
+
+	fn := c.NamedFunction("runtime.ifacetypeassert", "func(uintptr, uintptr)")
+	b.CreateCall(fn, []llvm.Value{iface_type, want_type}, "")
+
+	dst_llvm := c.types.ToLLVM(dst_typ)
+	ptr := b.CreateBitCast(iface_data, llvm.PointerType(dst_llvm, 0), "")
+	return c.NewLLVMValue(b.CreateLoad(ptr, ""), dst_typ)
+}
+
+// convertPointer handles pointer<->pointer and pointer<->uintptr (or
+// unsafe.Pointer) conversions.
+func (v *LLVMValue) convertPointer(src_typ, dst_typ, orig_dst_typ types.Type) (Value, bool) {
+	c := v.compiler
+	b := c.builder
+	_, src_is_ptr := src_typ.(*types.Pointer)
+	_, dst_is_ptr := dst_typ.(*types.Pointer)
+	src_basic, src_is_basic := src_typ.(*types.Basic)
+	dst_basic, dst_is_basic := dst_typ.(*types.Basic)
+
+	isPtrLike := func(basic *types.Basic, ok bool) bool {
+		return ok && (basic.Kind == types.UintptrKind || basic.Kind == types.UnsafePointerKind)
+	}
+
+	switch {
+	case src_is_ptr && dst_is_ptr:
+		dst_llvm := c.types.ToLLVM(orig_dst_typ)
+		return c.NewLLVMValue(b.CreateBitCast(v.value, dst_llvm, ""), orig_dst_typ), true
+	case src_is_ptr && isPtrLike(dst_basic, dst_is_basic):
+		dst_llvm := c.types.ToLLVM(orig_dst_typ)
+		if dst_basic.Kind == types.UnsafePointerKind {
+			return c.NewLLVMValue(b.CreateBitCast(v.value, dst_llvm, ""), orig_dst_typ), true
+		}
+		return c.NewLLVMValue(b.CreatePtrToInt(v.value, dst_llvm, ""), orig_dst_typ), true
+	case isPtrLike(src_basic, src_is_basic) && dst_is_ptr:
+		dst_llvm := c.types.ToLLVM(orig_dst_typ)
+		if src_basic.Kind == types.UnsafePointerKind {
+			return c.NewLLVMValue(b.CreateBitCast(v.value, dst_llvm, ""), orig_dst_typ), true
+		}
+		return c.NewLLVMValue(b.CreateIntToPtr(v.value, dst_llvm, ""), orig_dst_typ), true
+	case isPtrLike(src_basic, src_is_basic) && isPtrLike(dst_basic, dst_is_basic):
+		dst_llvm := c.types.ToLLVM(orig_dst_typ)
+		return c.NewLLVMValue(b.CreateBitCast(v.value, dst_llvm, ""), orig_dst_typ), true
+	}
+	return nil, false
+}
+
+// convertStringSlice handles the string <-> []byte and string <-> []rune
+// conversions, which require a runtime call since they copy the backing
+// array.
+func (v *LLVMValue) convertStringSlice(src_typ, dst_typ, orig_dst_typ types.Type) (Value, bool) {
+	c := v.compiler
+	b := c.builder
+
+	if src_basic, ok := src_typ.(*types.Basic); ok && src_basic.Kind == types.StringKind {
+		if dst_slice, ok := dst_typ.(*types.Slice); ok {
+			if elem, ok := dst_slice.Elt.(*types.Basic); ok {
+				switch elem.Kind {
+				case types.Uint8Kind:
+					fn := c.NamedFunction("runtime.stringtoslicebyte", "func(string) []byte")
+					result := b.CreateCall(fn, []llvm.Value{v.value}, "")
+					return c.NewLLVMValue(result, orig_dst_typ), true
+				case types.Int32Kind:
+					fn := c.NamedFunction("runtime.stringtoslicerune", "func(string) []rune")
+					result := b.CreateCall(fn, []llvm.Value{v.value}, "")
+					return c.NewLLVMValue(result, orig_dst_typ), true
+				}
+			}
+		}
+	}
+	if src_slice, ok := src_typ.(*types.Slice); ok {
+		if dst_basic, ok := dst_typ.(*types.Basic); ok && dst_basic.Kind == types.StringKind {
+			if elem, ok := src_slice.Elt.(*types.Basic); ok {
+				switch elem.Kind {
+				case types.Uint8Kind:
+					fn := c.NamedFunction("runtime.slicebytetostring", "func([]byte) string")
+					result := b.CreateCall(fn, []llvm.Value{v.value}, "")
+					return c.NewLLVMValue(result, orig_dst_typ), true
+				case types.Int32Kind:
+					fn := c.NamedFunction("runtime.slicerunetostring", "func([]rune) string")
+					result := b.CreateCall(fn, []llvm.Value{v.value}, "")
+					return c.NewLLVMValue(result, orig_dst_typ), true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
 func (v *LLVMValue) LLVMValue() llvm.Value {
 	return v.value
 }
@@ -352,6 +980,47 @@ func (v *LLVMValue) Deref() *LLVMValue {
 	return value
 }
 
+///////////////////////////////////////////////////////////////////////////////
+// NilValue methods.
+
+func (lhs NilValue) BinaryOp(op token.Token, rhs_ Value) Value {
+	switch rhs := rhs_.(type) {
+	case NilValue:
+		switch op {
+		case token.EQL:
+			return lhs.compiler.NewLLVMValue(llvm.ConstAllOnes(llvm.Int1Type()), types.Bool)
+		case token.NEQ:
+			return lhs.compiler.NewLLVMValue(llvm.ConstNull(llvm.Int1Type()), types.Bool)
+		}
+		panic(fmt.Sprint("Unimplemented operator: ", op))
+	case *LLVMValue:
+		// EQL/NEQ are symmetric, so just swap operands and let the typed
+		// side's specialised nil comparison handle it.
+		return rhs.BinaryOp(op, lhs)
+	}
+	panic("unreachable")
+}
+
+func (v NilValue) UnaryOp(op token.Token) Value {
+	panic(fmt.Sprint("Invalid unary operation on nil: ", op))
+}
+
+// Convert returns the zero value of dst_typ: llvm.ConstNull already
+// produces a zeroed aggregate for composite (struct/array) LLVM types, so
+// there's no need to special-case them here.
+func (v NilValue) Convert(dst_typ types.Type) Value {
+	llvm_type := v.compiler.types.ToLLVM(dst_typ)
+	return v.compiler.NewLLVMValue(llvm.ConstNull(llvm_type), dst_typ)
+}
+
+func (v NilValue) LLVMValue() llvm.Value {
+	panic("NilValue has no LLVM representation; Convert to a concrete type first")
+}
+
+func (v NilValue) Type() types.Type {
+	return &types.Basic{Kind: types.NilKind}
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // ConstValue methods.
 
@@ -372,43 +1041,31 @@ func (lhs ConstValue) BinaryOp(op token.Token, rhs_ Value) Value {
 		case types.UntypedComplexKind:
 			lhs = lhs.Convert(rhs.Type()).(ConstValue)
 		}
-		lhs_value := lhs.LLVMValue()
-
-		b := rhs.compiler.builder
-		var result llvm.Value
-		switch op {
-		case token.MUL:
-			result = b.CreateMul(lhs_value, rhs.value, "")
-		case token.QUO:
-			result = b.CreateUDiv(lhs_value, rhs.value, "")
-		case token.ADD:
-			result = b.CreateAdd(lhs_value, rhs.value, "")
-		case token.SUB:
-			result = b.CreateSub(lhs_value, rhs.value, "")
-		case token.NEQ:
-			result = b.CreateICmp(llvm.IntNE, lhs_value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.EQL:
-			result = b.CreateICmp(llvm.IntEQ, lhs_value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LSS:
-			result = b.CreateICmp(llvm.IntULT, lhs_value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LAND:
-			result = b.CreateAnd(lhs_value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		case token.LOR:
-			result = b.CreateOr(lhs_value, rhs.value, "")
-			return lhs.compiler.NewLLVMValue(result, types.Bool)
-		default:
-			panic(fmt.Sprint("Unimplemented operator: ", op))
+		lhs_llvm := rhs.compiler.NewLLVMValue(lhs.LLVMValue(), lhs.typ)
+		if basic, ok := types.Underlying(lhs.typ).(*types.Basic); ok {
+			if isComplex(basic.Kind) {
+				return lhs_llvm.binaryOpComplex(op, rhs)
+			}
+			if isFloat(basic.Kind) {
+				return lhs_llvm.binaryOpFloat(op, rhs)
+			}
 		}
-		return rhs.compiler.NewLLVMValue(result, lhs.typ)
+		return lhs_llvm.binaryOpInt(op, rhs.value)
 	case ConstValue:
-		// TODO Check if either one is untyped, and convert to the other's
-		// type.
+		// Constants are folded directly by types.Const, which operates on
+		// arbitrary precision big.Int/big.Rat values; we just need to work
+		// out which of the two (possibly untyped) operand types the result
+		// should carry.
 		c := lhs.compiler
 		typ := lhs.typ
+		switch {
+		case isUntypedNumeric(lhs.typ.Kind) && !isUntypedNumeric(rhs.typ.Kind):
+			typ = rhs.typ
+		case !isUntypedNumeric(lhs.typ.Kind) && isUntypedNumeric(rhs.typ.Kind):
+			typ = lhs.typ
+		case isUntypedNumeric(lhs.typ.Kind) && isUntypedNumeric(rhs.typ.Kind):
+			typ = &types.Basic{Kind: widerUntypedKind(lhs.typ.Kind, rhs.typ.Kind)}
+		}
 		return ConstValue{*lhs.Const.BinaryOp(op, &rhs.Const), c, typ}
 	}
 	panic("unimplemented")
@@ -457,21 +1114,51 @@ func (v ConstValue) LLVMValue() llvm.Value {
 
 	switch v.typ.Kind {
 	case types.UntypedIntKind:
-		// TODO 32/64bit
-		int_val := v.Val.(*big.Int)
-		if int_val.Cmp(maxBigInt32) > 0 || int_val.Cmp(minBigInt32) < 0 {
-			panic(fmt.Sprint("const ", int_val, " overflows int"))
-		}
-		return llvm.ConstInt(llvm.Int32Type(), uint64(v.Int64()), false)
+		// An untyped int constant defaults to int, whose width is
+		// target-dependent.
+		return v.intLLVMValue(v.compiler.target.IntPtrType().IntTypeWidth(), false)
 	case types.UntypedFloatKind:
-		fallthrough
+		// An untyped float constant defaults to float64.
+		r := v.Val.(*big.Rat)
+		f, _ := r.Float64()
+		return llvm.ConstFloat(llvm.DoubleType(), f)
 	case types.UntypedComplexKind:
-		panic("Attempting to take LLVM value of untyped constant")
-	case types.Int32Kind, types.Uint32Kind:
-		// XXX rune
-		return llvm.ConstInt(llvm.Int32Type(), uint64(v.Int64()), false)
-	case types.Int16Kind, types.Uint16Kind:
-		return llvm.ConstInt(llvm.Int16Type(), uint64(v.Int64()), false)
+		// An untyped complex constant defaults to complex128.
+		return v.complexLLVMValue(llvm.DoubleType())
+	case types.Float32Kind:
+		r := v.Val.(*big.Rat)
+		f, _ := r.Float64()
+		return llvm.ConstFloat(llvm.FloatType(), f)
+	case types.Float64Kind:
+		r := v.Val.(*big.Rat)
+		f, _ := r.Float64()
+		return llvm.ConstFloat(llvm.DoubleType(), f)
+	case types.Complex64Kind:
+		return v.complexLLVMValue(llvm.FloatType())
+	case types.Complex128Kind:
+		return v.complexLLVMValue(llvm.DoubleType())
+	case types.Int8Kind:
+		return v.intLLVMValue(8, false)
+	case types.Uint8Kind:
+		return v.intLLVMValue(8, true)
+	case types.Int16Kind:
+		return v.intLLVMValue(16, false)
+	case types.Uint16Kind:
+		return v.intLLVMValue(16, true)
+	case types.Int32Kind:
+		// Runes (CHAR literals) are represented as Int32Kind too; the same
+		// width and signedness rules apply to them.
+		return v.intLLVMValue(32, false)
+	case types.Uint32Kind:
+		return v.intLLVMValue(32, true)
+	case types.Int64Kind:
+		return v.intLLVMValue(64, false)
+	case types.Uint64Kind:
+		return v.intLLVMValue(64, true)
+	case types.IntKind:
+		return v.intLLVMValue(v.compiler.target.IntPtrType().IntTypeWidth(), false)
+	case types.UintKind, types.UintptrKind:
+		return v.intLLVMValue(v.compiler.target.IntPtrType().IntTypeWidth(), true)
 	case types.StringKind:
 		strval := (v.Val).(string)
 		ptr := v.compiler.builder.CreateGlobalStringPtr(strval, "")
@@ -500,4 +1187,160 @@ func (v ConstValue) Int64() int64 {
 	return int_val.Int64()
 }
 
+// complexLLVMValue returns the LLVM constant for a complex-kinded
+// ConstValue, laid out as a 2-element {real, imag} struct of float_type.
+func (v ConstValue) complexLLVMValue(float_type llvm.Type) llvm.Value {
+	c := v.Val.(types.Complex)
+	re, _ := c.Re.Float64()
+	im, _ := c.Im.Float64()
+	real_val := llvm.ConstFloat(float_type, re)
+	imag_val := llvm.ConstFloat(float_type, im)
+	return llvm.ConstStruct([]llvm.Value{real_val, imag_val}, false)
+}
+
+// intLLVMValue returns the LLVM integer constant for an integer-kinded
+// ConstValue of the given bit width and signedness, checking that the
+// arbitrary precision value actually fits.
+func (v ConstValue) intLLVMValue(width int, unsigned bool) llvm.Value {
+	int_val := v.Val.(*big.Int)
+	max, min := integerBounds(width, unsigned)
+	if int_val.Cmp(max) > 0 || int_val.Cmp(min) < 0 {
+		panic(fmt.Sprint("const ", int_val, " overflows ", width, "-bit ", v.typ.Kind))
+	}
+
+	// big.Int.Int64 silently truncates values that don't fit in an int64
+	// (e.g. large uint64 constants), so round-trip through Uint64 for
+	// non-negative values instead.
+	var u uint64
+	if int_val.Sign() < 0 {
+		u = uint64(int_val.Int64())
+	} else {
+		u = int_val.Uint64()
+	}
+	return llvm.ConstInt(llvm.IntType(width), u, false)
+}
+
+// integerBounds returns the inclusive [min, max] range representable by an
+// integer of the given width and signedness.
+func integerBounds(width int, unsigned bool) (max, min *big.Int) {
+	if unsigned {
+		max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(width)), big.NewInt(1))
+		return max, big.NewInt(0)
+	}
+	max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(width-1)), big.NewInt(1))
+	min = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(width-1)))
+	return max, min
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Map support.
+//
+// These lower uniformly through Value/LLVMValue, the same way string and
+// complex operations do above: each helper materializes a call to a small
+// runtime entry point, looked up via NamedFunction. mapLookup, mapDelete and
+// makeMap also pass the *types.Map descriptor as a uintptr so the runtime
+// can interpret the (type-erased) key/element bytes; mapLen and mapRange
+// pass only the map itself.
+
+// boolToU64 converts a bool to the 0/1 it's represented as in LLVM IR.
+func boolToU64(v bool) uint64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// spillToStack returns a pointer to key's bytes: if key already lives in
+// memory (e.g. it's an addressable variable) that address is reused,
+// otherwise a fresh stack alloca is created and the value stored into it.
+func (c *compiler) spillToStack(key Value) llvm.Value {
+	b := c.builder
+	var ptr llvm.Value
+	if lv, ok := key.(*LLVMValue); ok && lv.indirect {
+		ptr = lv.value
+	} else {
+		key_value := key.LLVMValue()
+		alloca := b.CreateAlloca(key_value.Type(), "")
+		b.CreateStore(key_value, alloca)
+		ptr = alloca
+	}
+	return b.CreateBitCast(ptr, llvm.PointerType(llvm.Int8Type(), 0), "")
+}
+
+// mapLookup looks up key in map m, returning a pointer to its element slot
+// and a boolean "present" flag, for use both by plain indexing (m[k], where
+// insert is true so a missing key gets a fresh zero-valued entry) and by
+// the ",ok" comma-ok form (insert is false, and a missing key yields a nil
+// element pointer that callers must not dereference).
+func (c *compiler) mapLookup(m *LLVMValue, key Value, insert bool) (*LLVMValue, *LLVMValue) {
+	b := c.builder
+	intptr_type := c.target.IntPtrType()
+	map_typ := types.Underlying(m.Type()).(*types.Map)
+
+	map_desc := llvm.ConstPtrToInt(c.types.ToRuntime(map_typ), intptr_type)
+	key_ptr := c.spillToStack(key)
+	insert_flag := llvm.ConstInt(llvm.Int1Type(), boolToU64(insert), false)
+
+	fn := c.NamedFunction("runtime.maplookup",
+		"func(uintptr, unsafe.Pointer, unsafe.Pointer, bool) (uintptr, bool)")
+	result := b.CreateCall(fn, []llvm.Value{map_desc, m.value, key_ptr, insert_flag}, "")
+
+	elem_uintptr := b.CreateExtractValue(result, 0, "")
+	present := b.CreateExtractValue(result, 1, "")
+
+	elem_ptr_typ := &types.Pointer{Base: map_typ.Elt}
+	elem_ptr := b.CreateIntToPtr(elem_uintptr, c.types.ToLLVM(elem_ptr_typ), "")
+	return c.NewLLVMValue(elem_ptr, elem_ptr_typ), c.NewLLVMValue(present, types.Bool)
+}
+
+// mapDelete removes key from map m, a no-op if the key isn't present.
+func (c *compiler) mapDelete(m *LLVMValue, key Value) {
+	b := c.builder
+	intptr_type := c.target.IntPtrType()
+	map_typ := types.Underlying(m.Type()).(*types.Map)
+
+	map_desc := llvm.ConstPtrToInt(c.types.ToRuntime(map_typ), intptr_type)
+	key_ptr := c.spillToStack(key)
+
+	fn := c.NamedFunction("runtime.mapdelete", "func(uintptr, unsafe.Pointer, unsafe.Pointer)")
+	b.CreateCall(fn, []llvm.Value{map_desc, m.value, key_ptr}, "")
+}
+
+// mapLen returns the number of entries in map m.
+func (c *compiler) mapLen(m *LLVMValue) *LLVMValue {
+	fn := c.NamedFunction("runtime.maplen", "func(unsafe.Pointer) int")
+	result := c.builder.CreateCall(fn, []llvm.Value{m.value}, "")
+	return c.NewLLVMValue(result, types.Int)
+}
+
+// mapRange begins a "for range" over map m, returning an opaque iterator
+// state Value that the statement compiler drives with further calls to
+// runtime.mapiternext.
+func (c *compiler) mapRange(m *LLVMValue) *LLVMValue {
+	fn := c.NamedFunction("runtime.mapiterinit", "func(unsafe.Pointer) unsafe.Pointer")
+	iter := c.builder.CreateCall(fn, []llvm.Value{m.value}, "")
+	iter_typ := &types.Basic{Kind: types.UnsafePointerKind}
+	return c.NewLLVMValue(iter, iter_typ)
+}
+
+// makeMap allocates a new map of the given type. hint, if non-nil, is a
+// size hint for the number of entries the map is expected to hold (as in
+// "make(map[K]V, hint)"); pass nil for the no-hint form.
+func (c *compiler) makeMap(mapType *types.Map, hint Value) *LLVMValue {
+	b := c.builder
+	intptr_type := c.target.IntPtrType()
+	map_desc := llvm.ConstPtrToInt(c.types.ToRuntime(mapType), intptr_type)
+
+	var hint_value llvm.Value
+	if hint != nil {
+		hint_value = hint.LLVMValue()
+	} else {
+		hint_value = llvm.ConstInt(c.types.ToLLVM(types.Int), 0, false)
+	}
+
+	fn := c.NamedFunction("runtime.makemap", "func(uintptr, int) unsafe.Pointer")
+	result := b.CreateCall(fn, []llvm.Value{map_desc, hint_value}, "")
+	return c.NewLLVMValue(result, mapType)
+}
+
 // vim: set ft=go :
\ No newline at end of file
@@ -0,0 +1,432 @@
+package llgo
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/axw/gollvm/llvm"
+	"github.com/axw/llgo/types"
+)
+
+// newTestCompiler returns a *compiler with just enough of a target set up
+// (an IntPtrType of the given width) for ConstValue.LLVMValue's integer
+// conversions to run; it has no builder or type map, so it can't be used
+// for anything beyond the pure constant-folding paths exercised below.
+func newTestCompiler(intPtrWidth int) *compiler {
+	return &compiler{target: fakeTargetData{intPtrWidth}}
+}
+
+// fakeTargetData implements just enough of the llvm.TargetData interface
+// (as used by ConstValue.LLVMValue) to drive IntKind/UintKind/UintptrKind
+// conversions at a chosen pointer width, without needing a real llvm
+// target triple.
+type fakeTargetData struct {
+	intPtrWidth int
+}
+
+func (f fakeTargetData) IntPtrType() llvm.Type {
+	return llvm.IntType(f.intPtrWidth)
+}
+
+// fakeTypeMap implements just enough of the compiler's c.types to drive
+// LLVMValue.Convert's basic-to-basic numeric paths (convertIntToInt,
+// convertFloatToFloat, convertIntToFloat, convertFloatToInt,
+// convertComplex) and convertPointer, without needing a real type map.
+type fakeTypeMap struct {
+	intPtrWidth int
+}
+
+func (f fakeTypeMap) ToLLVM(t types.Type) llvm.Type {
+	t = types.Underlying(t)
+	if ptr, ok := t.(*types.Pointer); ok {
+		return llvm.PointerType(f.ToLLVM(ptr.Base), 0)
+	}
+	basic, ok := t.(*types.Basic)
+	if !ok {
+		panic(fmt.Sprint("fakeTypeMap.ToLLVM: unsupported type ", t))
+	}
+	switch basic.Kind {
+	case types.Int8Kind, types.Uint8Kind:
+		return llvm.IntType(8)
+	case types.Int16Kind, types.Uint16Kind:
+		return llvm.IntType(16)
+	case types.Int32Kind, types.Uint32Kind:
+		return llvm.IntType(32)
+	case types.Int64Kind, types.Uint64Kind:
+		return llvm.IntType(64)
+	case types.IntKind, types.UintKind, types.UintptrKind:
+		return llvm.IntType(f.intPtrWidth)
+	case types.Float32Kind:
+		return llvm.FloatType()
+	case types.Float64Kind:
+		return llvm.DoubleType()
+	case types.Complex64Kind:
+		return llvm.StructType([]llvm.Type{llvm.FloatType(), llvm.FloatType()}, false)
+	case types.Complex128Kind:
+		return llvm.StructType([]llvm.Type{llvm.DoubleType(), llvm.DoubleType()}, false)
+	case types.UnsafePointerKind:
+		return llvm.PointerType(llvm.Int8Type(), 0)
+	}
+	panic(fmt.Sprint("fakeTypeMap.ToLLVM: unsupported kind ", basic.Kind))
+}
+
+func (f fakeTypeMap) ToRuntime(t types.Type) llvm.Value {
+	panic("fakeTypeMap.ToRuntime: not implemented in tests")
+}
+
+// newConvertTestCompiler returns a *compiler with a real builder positioned
+// inside a throwaway function, plus a fakeTypeMap — enough to drive
+// LLVMValue.Convert's numeric and pointer paths, which only touch
+// c.builder/c.target/c.types. The caller must call the returned cleanup
+// func once done. Conversions that go via runtime.* calls (NamedFunction),
+// such as string<->[]byte/[]rune and interface conversions, aren't
+// reachable this way since NamedFunction's real implementation lives
+// outside this file.
+func newConvertTestCompiler(t *testing.T, intPtrWidth int) (*compiler, func()) {
+	t.Helper()
+	mod := llvm.NewModule("test")
+	fn := llvm.AddFunction(mod, "test", llvm.FunctionType(llvm.VoidType(), nil, false))
+	entry := llvm.AddBasicBlock(fn, "entry")
+	b := llvm.NewBuilder()
+	b.SetInsertPointAtEnd(entry)
+
+	c := &compiler{
+		builder: b,
+		target:  fakeTargetData{intPtrWidth},
+		types:   fakeTypeMap{intPtrWidth},
+	}
+	return c, func() {
+		b.Dispose()
+		mod.Dispose()
+	}
+}
+
+// truncateToWidth returns the low `width` bits of n, the same two's
+// complement truncation a CPU (and convertIntToInt) performs when
+// narrowing an integer.
+func truncateToWidth(n *big.Int, width int) *big.Int {
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(width)), big.NewInt(1))
+	return new(big.Int).And(n, mask)
+}
+
+// constValueForLiteral evaluates lit with go/constant and wraps it as a
+// ConstValue of the given kind, the same way the frontend would for a
+// literal expression.
+func constValueForLiteral(t *testing.T, lit string, c *compiler, kind types.BasicKind) ConstValue {
+	t.Helper()
+	v := constant.MakeFromLiteral(lit, token.INT, 0)
+	if v.Kind() == constant.Unknown {
+		t.Fatalf("bad integer literal %q", lit)
+	}
+	n, exact := constant.Int64Val(v)
+	var big_val *big.Int
+	if exact {
+		big_val = big.NewInt(n)
+	} else {
+		u, _ := constant.Uint64Val(v)
+		big_val = new(big.Int).SetUint64(u)
+	}
+	return ConstValue{types.Const{Val: big_val}, c, &types.Basic{Kind: kind}}
+}
+
+// TestConstValueLLVMValueIntWidths checks that ConstValue.LLVMValue picks
+// the right bit width and round-trips the value correctly for every sized
+// integer kind, including the target-dependent IntKind on both a 32-bit and
+// a 64-bit target and UintptrKind on a 32-bit target, against
+// go/constant-evaluated expectations.
+func TestConstValueLLVMValueIntWidths(t *testing.T) {
+	c32 := newTestCompiler(32)
+	c64 := newTestCompiler(64)
+
+	tests := []struct {
+		name     string
+		compiler *compiler
+		kind     types.BasicKind
+		lit      string
+		wantBits int
+	}{
+		{"int8 max", c64, types.Int8Kind, "127", 8},
+		{"int8 min", c64, types.Int8Kind, "-128", 8},
+		{"uint8 max", c64, types.Uint8Kind, "255", 8},
+		{"int16 min", c64, types.Int16Kind, "-32768", 16},
+		{"int32/rune max", c64, types.Int32Kind, "2147483647", 32},
+		{"uint32 max", c64, types.Uint32Kind, "4294967295", 32},
+		{"int64 min", c64, types.Int64Kind, "-9223372036854775808", 64},
+		{"uint64 max", c64, types.Uint64Kind, "18446744073709551615", 64},
+		{"int on 32-bit target", c32, types.IntKind, "2147483647", 32},
+		{"int on 64-bit target", c64, types.IntKind, "9223372036854775807", 64},
+		{"uintptr on 32-bit target", c32, types.UintptrKind, "4294967295", 32},
+		{"untyped int defaults to target int width", c32, types.UntypedIntKind, "42", 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cv := constValueForLiteral(t, tt.lit, tt.compiler, tt.kind)
+			n := cv.Val.(*big.Int)
+
+			got := cv.LLVMValue()
+			if width := got.Type().IntTypeWidth(); width != tt.wantBits {
+				t.Fatalf("width = %d, want %d", width, tt.wantBits)
+			}
+
+			unsigned := isUnsigned(tt.kind)
+			var want llvm.Value
+			if n.Sign() < 0 {
+				want = llvm.ConstInt(llvm.IntType(tt.wantBits), uint64(n.Int64()), false)
+			} else {
+				want = llvm.ConstInt(llvm.IntType(tt.wantBits), n.Uint64(), unsigned)
+			}
+			if got.String() != want.String() {
+				t.Fatalf("value = %s, want %s", got.String(), want.String())
+			}
+		})
+	}
+}
+
+// TestConstValueLLVMValueIntOverflowPanics checks that a constant that
+// doesn't fit in its destination kind's width is rejected rather than
+// silently truncated.
+func TestConstValueLLVMValueIntOverflowPanics(t *testing.T) {
+	cv := constValueForLiteral(t, "256", newTestCompiler(64), types.Uint8Kind)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic converting 256 to a uint8 constant")
+		}
+	}()
+	cv.LLVMValue()
+}
+
+// TestConstValueLLVMValueFloat checks the float32/float64/untyped-float
+// constant-folding paths against go/constant-evaluated expectations.
+func TestConstValueLLVMValueFloat(t *testing.T) {
+	c := newTestCompiler(64)
+
+	// 0.25 is exactly representable in both float32 and float64, so the
+	// go/constant-evaluated value and the round-tripped big.Rat agree bit
+	// for bit with what LLVMValue produces.
+	lit := constant.MakeFromLiteral("0.25", token.FLOAT, 0)
+	wantF, _ := constant.Float64Val(lit)
+	r := new(big.Rat).SetFloat64(wantF)
+
+	tests := []struct {
+		name     string
+		kind     types.BasicKind
+		llvmType llvm.Type
+	}{
+		{"float32", types.Float32Kind, llvm.FloatType()},
+		{"float64", types.Float64Kind, llvm.DoubleType()},
+		{"untyped float defaults to float64", types.UntypedFloatKind, llvm.DoubleType()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cv := ConstValue{types.Const{Val: r}, c, &types.Basic{Kind: tt.kind}}
+			got := cv.LLVMValue()
+			want := llvm.ConstFloat(tt.llvmType, wantF)
+			if got.String() != want.String() {
+				t.Fatalf("value = %s, want %s", got.String(), want.String())
+			}
+		})
+	}
+}
+
+// TestLLVMValueConvertInt drives LLVMValue.Convert's integer<->integer
+// path (convertIntToInt), checking both the resulting width and the
+// truncated/extended bit pattern against an independently-computed
+// expectation.
+func TestLLVMValueConvertInt(t *testing.T) {
+	c, cleanup := newConvertTestCompiler(t, 64)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		srcKind  types.BasicKind
+		srcBits  int
+		srcVal   int64
+		dstKind  types.BasicKind
+		wantBits int
+		unsigned bool
+	}{
+		{"int32 -> int64 sign-extends", types.Int32Kind, 32, -5, types.Int64Kind, 64, false},
+		{"int64 -> int8 truncates", types.Int64Kind, 64, 300, types.Int8Kind, 8, false},
+		{"uint32 -> uint64 zero-extends", types.Uint32Kind, 32, 5, types.Uint64Kind, 64, true},
+		{"int8 -> int8 is a no-op", types.Int8Kind, 8, 7, types.Int8Kind, 8, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src_llvm := llvm.ConstInt(llvm.IntType(tt.srcBits), uint64(tt.srcVal), true)
+			src := c.NewLLVMValue(src_llvm, &types.Basic{Kind: tt.srcKind})
+
+			got := src.Convert(&types.Basic{Kind: tt.dstKind}).LLVMValue()
+			if width := got.Type().IntTypeWidth(); width != tt.wantBits {
+				t.Fatalf("width = %d, want %d", width, tt.wantBits)
+			}
+
+			// go/constant independently re-derives the source value; the
+			// truncation to the destination width mirrors what the
+			// underlying hardware (and convertIntToInt) does when
+			// narrowing a two's complement integer.
+			lit := constant.MakeInt64(tt.srcVal)
+			n, _ := constant.Int64Val(lit)
+			want_val := truncateToWidth(big.NewInt(n), tt.wantBits)
+			want := llvm.ConstInt(llvm.IntType(tt.wantBits), want_val.Uint64(), tt.unsigned)
+			if got.String() != want.String() {
+				t.Fatalf("value = %s, want %s", got.String(), want.String())
+			}
+		})
+	}
+}
+
+// TestLLVMValueConvertFloat drives LLVMValue.Convert's float<->float,
+// int<->float, and float<->int paths (convertFloatToFloat,
+// convertIntToFloat, convertFloatToInt).
+func TestLLVMValueConvertFloat(t *testing.T) {
+	c, cleanup := newConvertTestCompiler(t, 64)
+	defer cleanup()
+
+	t.Run("float32 -> float64 extends", func(t *testing.T) {
+		lit := constant.MakeFromLiteral("1.5", token.FLOAT, 0)
+		wantF, _ := constant.Float64Val(lit)
+
+		src := c.NewLLVMValue(llvm.ConstFloat(llvm.FloatType(), wantF), &types.Basic{Kind: types.Float32Kind})
+		got := src.Convert(&types.Basic{Kind: types.Float64Kind}).LLVMValue()
+		if got.Type() != llvm.DoubleType() {
+			t.Fatalf("type = %v, want double", got.Type())
+		}
+		want := llvm.ConstFloat(llvm.DoubleType(), wantF)
+		if got.String() != want.String() {
+			t.Fatalf("value = %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("int32 -> float64", func(t *testing.T) {
+		lit := constant.MakeInt64(-42)
+		n, _ := constant.Int64Val(lit)
+
+		src := c.NewLLVMValue(llvm.ConstInt(llvm.Int32Type(), uint64(n), true), &types.Basic{Kind: types.Int32Kind})
+		got := src.Convert(&types.Basic{Kind: types.Float64Kind}).LLVMValue()
+		if got.Type() != llvm.DoubleType() {
+			t.Fatalf("type = %v, want double", got.Type())
+		}
+		want := llvm.ConstFloat(llvm.DoubleType(), float64(n))
+		if got.String() != want.String() {
+			t.Fatalf("value = %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("float64 -> int32 truncates toward zero", func(t *testing.T) {
+		src := c.NewLLVMValue(llvm.ConstFloat(llvm.DoubleType(), 3.9), &types.Basic{Kind: types.Float64Kind})
+		got := src.Convert(&types.Basic{Kind: types.Int32Kind}).LLVMValue()
+		if width := got.Type().IntTypeWidth(); width != 32 {
+			t.Fatalf("width = %d, want 32", width)
+		}
+		want := llvm.ConstInt(llvm.Int32Type(), 3, false)
+		if got.String() != want.String() {
+			t.Fatalf("value = %s, want %s", got.String(), want.String())
+		}
+	})
+}
+
+// TestLLVMValueConvertComplex drives LLVMValue.Convert's complex path
+// (convertComplex), both widening complex64 -> complex128 and promoting a
+// plain float64 to complex128 with a zero imaginary part.
+func TestLLVMValueConvertComplex(t *testing.T) {
+	c, cleanup := newConvertTestCompiler(t, 64)
+	defer cleanup()
+
+	t.Run("complex64 -> complex128", func(t *testing.T) {
+		cplx := llvm.ConstStruct([]llvm.Value{
+			llvm.ConstFloat(llvm.FloatType(), 1.5),
+			llvm.ConstFloat(llvm.FloatType(), -2.5),
+		}, false)
+		src := c.NewLLVMValue(cplx, &types.Basic{Kind: types.Complex64Kind})
+		got := src.Convert(&types.Basic{Kind: types.Complex128Kind}).LLVMValue()
+		want := llvm.ConstStruct([]llvm.Value{
+			llvm.ConstFloat(llvm.DoubleType(), 1.5),
+			llvm.ConstFloat(llvm.DoubleType(), -2.5),
+		}, false)
+		if got.String() != want.String() {
+			t.Fatalf("value = %s, want %s", got.String(), want.String())
+		}
+	})
+
+	t.Run("float64 -> complex128 sets imag to 0", func(t *testing.T) {
+		src := c.NewLLVMValue(llvm.ConstFloat(llvm.DoubleType(), 4), &types.Basic{Kind: types.Float64Kind})
+		got := src.Convert(&types.Basic{Kind: types.Complex128Kind}).LLVMValue()
+		want := llvm.ConstStruct([]llvm.Value{
+			llvm.ConstFloat(llvm.DoubleType(), 4),
+			llvm.ConstFloat(llvm.DoubleType(), 0),
+		}, false)
+		if got.String() != want.String() {
+			t.Fatalf("value = %s, want %s", got.String(), want.String())
+		}
+	})
+}
+
+// TestLLVMValueConvertPointer drives LLVMValue.Convert's pointer<->pointer
+// and pointer<->uintptr/unsafe.Pointer paths (convertPointer).
+func TestLLVMValueConvertPointer(t *testing.T) {
+	c, cleanup := newConvertTestCompiler(t, 64)
+	defer cleanup()
+
+	int_ptr_typ := &types.Pointer{Base: types.Int}
+	byte_ptr_typ := &types.Pointer{Base: types.Byte}
+
+	t.Run("*int -> *byte bitcasts", func(t *testing.T) {
+		ptr_llvm := llvm.ConstPointerNull(llvm.PointerType(llvm.IntType(64), 0))
+		src := c.NewLLVMValue(ptr_llvm, int_ptr_typ)
+		got := src.Convert(byte_ptr_typ).LLVMValue()
+		if got.Type() != llvm.PointerType(llvm.Int8Type(), 0) {
+			t.Fatalf("type = %v, want *byte", got.Type())
+		}
+	})
+
+	t.Run("*int -> uintptr", func(t *testing.T) {
+		ptr_llvm := llvm.ConstPointerNull(llvm.PointerType(llvm.IntType(64), 0))
+		src := c.NewLLVMValue(ptr_llvm, int_ptr_typ)
+		got := src.Convert(&types.Basic{Kind: types.UintptrKind}).LLVMValue()
+		if width := got.Type().IntTypeWidth(); width != 64 {
+			t.Fatalf("width = %d, want 64", width)
+		}
+	})
+}
+
+// TestConstValueLLVMValueComplex checks the complex64/complex128/
+// untyped-complex constant-folding paths.
+func TestConstValueLLVMValueComplex(t *testing.T) {
+	c := newTestCompiler(64)
+	re := big.NewRat(3, 2)
+	im := big.NewRat(-1, 2)
+	cplx := types.Complex{Re: re, Im: im}
+	wantRe, _ := re.Float64()
+	wantIm, _ := im.Float64()
+
+	tests := []struct {
+		name     string
+		kind     types.BasicKind
+		llvmType llvm.Type
+	}{
+		{"complex64", types.Complex64Kind, llvm.FloatType()},
+		{"complex128", types.Complex128Kind, llvm.DoubleType()},
+		{"untyped complex defaults to complex128", types.UntypedComplexKind, llvm.DoubleType()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cv := ConstValue{types.Const{Val: cplx}, c, &types.Basic{Kind: tt.kind}}
+			got := cv.LLVMValue()
+			want := llvm.ConstStruct([]llvm.Value{
+				llvm.ConstFloat(tt.llvmType, wantRe),
+				llvm.ConstFloat(tt.llvmType, wantIm),
+			}, false)
+			if got.String() != want.String() {
+				t.Fatalf("value = %s, want %s", got.String(), want.String())
+			}
+		})
+	}
+}